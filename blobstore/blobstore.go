@@ -0,0 +1,63 @@
+// Package blobstore defines the Backend interface that blob storage
+// backends implement, and a registry that constructs a Backend from a
+// URL by dispatching on its scheme (s3://, file://, http(s)://,
+// ipfs://, gs://). This replaces the old hardcoded, recompile-to-change
+// blobstore with the "-s <url>" blobstore selection the data-blob docs
+// have long promised.
+package blobstore
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// Backend is a blob store: a place blobs can be Put, fetched with Get,
+// checked for existence with Stat, removed with Delete, and walked
+// with Enumerate. Keys are opaque strings (in this module, blob keys
+// of the form "/blob/<hash>").
+type Backend interface {
+	// Stat reports the size and existence of key.
+	Stat(key string) (size int64, exists bool, err error)
+
+	// Get returns a reader for the contents of key. Callers must
+	// Close it.
+	Get(key string) (io.ReadCloser, error)
+
+	// Put uploads size bytes read from r under key.
+	Put(key string, r io.Reader, size int64) error
+
+	// Delete removes key from the backend.
+	Delete(key string) error
+
+	// Enumerate lists every key with the given prefix, sending each
+	// one on ch. It closes ch when done, whether or not it errored.
+	Enumerate(prefix string, ch chan<- string) error
+}
+
+// Factory constructs a Backend from a parsed blobstore URL.
+type Factory func(u *url.URL) (Backend, error)
+
+var registry = map[string]Factory{}
+
+// Register associates a URL scheme (e.g. "s3", "file") with a Factory.
+// Backends call this from an init() to register themselves.
+func Register(scheme string, factory Factory) {
+	registry[scheme] = factory
+}
+
+// Open parses rawurl and constructs the Backend registered for its
+// scheme.
+func Open(rawurl string) (Backend, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, found := registry[u.Scheme]
+	if !found {
+		return nil, fmt.Errorf("blobstore: no backend registered for scheme %q (url: %s)", u.Scheme, rawurl)
+	}
+
+	return factory(u)
+}
@@ -0,0 +1,75 @@
+package blobstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOpenDispatchesByScheme(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatalf("Open(file://): %v", err)
+	}
+	if _, ok := b.(*fileBackend); !ok {
+		t.Fatalf("Open(file://) returned %T, want *fileBackend", b)
+	}
+}
+
+func TestOpenUnknownScheme(t *testing.T) {
+	if _, err := Open("bogus://somewhere"); err == nil {
+		t.Fatal("expected an error for an unregistered scheme, got nil")
+	}
+}
+
+func TestFileBackendPutGetStatDeleteEnumerate(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("some blob content")
+	if err := b.Put("/blob/abc", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	size, exists, err := b.Stat("/blob/abc")
+	if err != nil || !exists || size != int64(len(content)) {
+		t.Fatalf("Stat: size=%d exists=%v err=%v", size, exists, err)
+	}
+
+	r, err := b.Get("/blob/abc")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Get content mismatch: got %q, want %q", got, content)
+	}
+
+	ch := make(chan string, 10)
+	if err := b.Enumerate("/blob/", ch); err != nil {
+		t.Fatalf("Enumerate: %v", err)
+	}
+	var keys []string
+	for k := range ch {
+		keys = append(keys, k)
+	}
+	if len(keys) != 1 || keys[0] != "/blob/abc" {
+		t.Fatalf("Enumerate: got %v, want [/blob/abc]", keys)
+	}
+
+	if err := b.Delete("/blob/abc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, exists, err := b.Stat("/blob/abc"); err != nil || exists {
+		t.Fatalf("Stat after Delete: exists=%v err=%v", exists, err)
+	}
+}
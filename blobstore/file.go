@@ -0,0 +1,97 @@
+package blobstore
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileBackend stores blobs as files under a root directory. Keys are
+// sanitized into relative paths (e.g. "/blob/abc..." -> root/blob/abc...).
+type fileBackend struct {
+	root string
+}
+
+func init() {
+	Register("file", newFileBackend)
+}
+
+func newFileBackend(u *url.URL) (Backend, error) {
+	root := u.Path
+	if root == "" {
+		root = u.Opaque
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &fileBackend{root: root}, nil
+}
+
+func (b *fileBackend) path(key string) string {
+	return filepath.Join(b.root, filepath.FromSlash(strings.TrimPrefix(key, "/")))
+}
+
+func (b *fileBackend) Stat(key string) (int64, bool, error) {
+	info, err := os.Stat(b.path(key))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return info.Size(), true, nil
+}
+
+func (b *fileBackend) Get(key string) (io.ReadCloser, error) {
+	return os.Open(b.path(key))
+}
+
+func (b *fileBackend) Put(key string, r io.Reader, size int64) error {
+	p := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func (b *fileBackend) Delete(key string) error {
+	return os.Remove(b.path(key))
+}
+
+func (b *fileBackend) Enumerate(prefix string, ch chan<- string) error {
+	defer close(ch)
+
+	root := b.path(prefix)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+
+		ch <- "/" + filepath.ToSlash(rel)
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package blobstore
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// gsBackend reads blobs straight off a public Google Cloud Storage
+// bucket over HTTPS. Like s3Backend, writing requires authenticated
+// requests that aren't wired up yet.
+type gsBackend struct {
+	bucket string
+	http   *httpBackend
+}
+
+func init() {
+	Register("gs", newGSBackend)
+}
+
+func newGSBackend(u *url.URL) (Backend, error) {
+	bucket := u.Host
+	base := fmt.Sprintf("https://storage.googleapis.com/%s", bucket)
+	return &gsBackend{bucket: bucket, http: &httpBackend{base: base}}, nil
+}
+
+func (b *gsBackend) Stat(key string) (int64, bool, error) {
+	return b.http.Stat(key)
+}
+
+func (b *gsBackend) Get(key string) (io.ReadCloser, error) {
+	return b.http.Get(key)
+}
+
+func (b *gsBackend) Put(key string, r io.Reader, size int64) error {
+	return fmt.Errorf("blobstore: gs backend needs authenticated requests to write to %s, not yet supported", b.bucket)
+}
+
+func (b *gsBackend) Delete(key string) error {
+	return fmt.Errorf("blobstore: gs backend needs authenticated requests to write to %s, not yet supported", b.bucket)
+}
+
+func (b *gsBackend) Enumerate(prefix string, ch chan<- string) error {
+	close(ch)
+	return fmt.Errorf("blobstore: gs backend does not yet support enumeration (needs bucket listing API)")
+}
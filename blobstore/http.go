@@ -0,0 +1,72 @@
+package blobstore
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// httpBackend is a read-only backend that fetches blobs from a static
+// HTTP(S) file server, using key as a path relative to the base URL.
+// It also underlies the s3 and gs backends, which are just HTTPS
+// object stores once credentials aren't required (i.e. public buckets).
+type httpBackend struct {
+	base string
+}
+
+func init() {
+	Register("http", newHTTPBackend)
+	Register("https", newHTTPBackend)
+}
+
+func newHTTPBackend(u *url.URL) (Backend, error) {
+	return &httpBackend{base: u.String()}, nil
+}
+
+func (b *httpBackend) url(key string) string {
+	return strings.TrimRight(b.base, "/") + "/" + strings.TrimLeft(key, "/")
+}
+
+func (b *httpBackend) Stat(key string) (int64, bool, error) {
+	resp, err := http.Head(b.url(key))
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("blobstore: HEAD %s: %s", b.url(key), resp.Status)
+	}
+
+	return resp.ContentLength, true, nil
+}
+
+func (b *httpBackend) Get(key string) (io.ReadCloser, error) {
+	resp, err := http.Get(b.url(key))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("blobstore: GET %s: %s", b.url(key), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (b *httpBackend) Put(key string, r io.Reader, size int64) error {
+	return fmt.Errorf("blobstore: http backend is read-only, cannot put %s", key)
+}
+
+func (b *httpBackend) Delete(key string) error {
+	return fmt.Errorf("blobstore: http backend is read-only, cannot delete %s", key)
+}
+
+func (b *httpBackend) Enumerate(prefix string, ch chan<- string) error {
+	close(ch)
+	return fmt.Errorf("blobstore: http backend does not support enumeration")
+}
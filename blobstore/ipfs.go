@@ -0,0 +1,50 @@
+package blobstore
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// ipfsBackend fetches blobs through a local IPFS gateway. IPFS is
+// itself content-addressed, so this only supports reading blobs that
+// were published under an IPFS path equal to their key; adding blobs
+// requires talking to the ipfs daemon's API (not wired up yet).
+type ipfsBackend struct {
+	gateway string
+	http    *httpBackend
+}
+
+func init() {
+	Register("ipfs", newIPFSBackend)
+}
+
+func newIPFSBackend(u *url.URL) (Backend, error) {
+	gateway := u.Host
+	if gateway == "" {
+		gateway = "localhost:8080"
+	}
+	base := fmt.Sprintf("http://%s/ipfs", gateway)
+	return &ipfsBackend{gateway: gateway, http: &httpBackend{base: base}}, nil
+}
+
+func (b *ipfsBackend) Stat(key string) (int64, bool, error) {
+	return b.http.Stat(key)
+}
+
+func (b *ipfsBackend) Get(key string) (io.ReadCloser, error) {
+	return b.http.Get(key)
+}
+
+func (b *ipfsBackend) Put(key string, r io.Reader, size int64) error {
+	return fmt.Errorf("blobstore: ipfs backend can't add content through the gateway, not yet supported")
+}
+
+func (b *ipfsBackend) Delete(key string) error {
+	return fmt.Errorf("blobstore: ipfs backend does not support delete (content is addressed by the network, not this node)")
+}
+
+func (b *ipfsBackend) Enumerate(prefix string, ch chan<- string) error {
+	close(ch)
+	return fmt.Errorf("blobstore: ipfs backend does not support enumeration")
+}
@@ -0,0 +1,47 @@
+package blobstore
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// s3Backend reads blobs straight off a public S3 bucket over HTTPS
+// (no signing). Writing requires AWS request signing, which isn't
+// wired up yet -- Put/Delete/Enumerate return an error until a real
+// AWS SDK dependency is added.
+type s3Backend struct {
+	bucket string
+	http   *httpBackend
+}
+
+func init() {
+	Register("s3", newS3Backend)
+}
+
+func newS3Backend(u *url.URL) (Backend, error) {
+	bucket := u.Host
+	base := fmt.Sprintf("https://%s.s3.amazonaws.com", bucket)
+	return &s3Backend{bucket: bucket, http: &httpBackend{base: base}}, nil
+}
+
+func (b *s3Backend) Stat(key string) (int64, bool, error) {
+	return b.http.Stat(key)
+}
+
+func (b *s3Backend) Get(key string) (io.ReadCloser, error) {
+	return b.http.Get(key)
+}
+
+func (b *s3Backend) Put(key string, r io.Reader, size int64) error {
+	return fmt.Errorf("blobstore: s3 backend needs signed requests to write to %s, not yet supported", b.bucket)
+}
+
+func (b *s3Backend) Delete(key string) error {
+	return fmt.Errorf("blobstore: s3 backend needs signed requests to write to %s, not yet supported", b.bucket)
+}
+
+func (b *s3Backend) Enumerate(prefix string, ch chan<- string) error {
+	close(ch)
+	return fmt.Errorf("blobstore: s3 backend does not yet support enumeration (needs bucket listing API)")
+}
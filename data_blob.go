@@ -2,11 +2,20 @@ package data
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/gonuts/flag"
 	"github.com/jbenet/commander"
 	"io"
 	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 var cmd_data_blob = &commander.Command{
@@ -25,11 +34,33 @@ var cmd_data_blob = &commander.Command{
     What is a blob?
 
     Datasets are made up of files, which are made up of blobs.
-    (For now, 1 file is 1 blob. Chunking to be implemented)
     Blobs are basically blocks of data, which are checksummed
     (for integrity, de-duplication, and addressing) using a crypto-
-    graphic hash function (sha1, for now). If git comes to mind,
-    that's exactly right.
+    graphic hash function. If git comes to mind, that's exactly right.
+
+    Hash algorithms
+
+    Hashes are multihash-style strings: "<algo>-<hex>" (sha256-...,
+    blake2b-...), except sha1, which is kept as a bare 40-hex-character
+    string for backwards compatibility with existing blobs. Whichever
+    algorithm a <hash> argument names is the one used to verify it:
+    "data blob check" and the chunker both recompute using the prefix
+    on the hash they were given, rather than assuming sha1.
+
+    Chunking
+
+    Large files are split into content-defined chunks before being
+    stored: a rolling hash finds chunk boundaries based on content,
+    not fixed offsets, so near-duplicate files end up sharing most of
+    their chunks. Each chunk is stored as its own blob, and a small
+    chunk-list manifest (listing the chunks, in order) is stored under
+    the file's hash. "data blob check" walks a chunk-list and verifies
+    every chunk it references.
+
+    Blobs published before chunk-list manifests existed have no
+    manifest, just the raw blob contents under their hash; get/check
+    fall back to reading those directly, so pre-existing datasets
+    keep working unchanged.
 
     Local Blobstores
 
@@ -51,9 +82,47 @@ var cmd_data_blob = &commander.Command{
     together to ensure consistency. Please do not publish datasets to
     an index if blobs aren't in that index)
 
-    data can use any remote blobstore you wish. (For now, you have to
-    recompile, but in the future, you will be able to) Just change the
-    datadex configuration variable. Or pass in "-s <url>" per command.
+    data can use any remote blobstore you wish: pass "-s <url>" to
+    put/get/check, with a scheme telling data which backend to use
+    (s3://, file://, http(s)://, ipfs://, gs://). Without "-s", the
+    default blobstore/datadex is used, unless ~/.data/blobstores names
+    an ordered chain of backend URLs (one per line) to read across
+    instead -- gets and checks try each store in turn and fall back to
+    the next on miss, while puts always go to the first. This is handy
+    for reading through a local mirror before falling back to the
+    origin, without passing "-s" on every command.
+
+    Caching
+
+    Fetching a blob from a remote blobstore also populates a local
+    read-through cache (~/.data/cache by default). Later gets of the
+    same blob are served from there instead of going back over the
+    network; since blobs are content-addressed, cache entries never
+    need invalidating, only eviction once the cache passes its size
+    cap ("-cache-size", default 10GiB). See "data blob cache".
+
+    Encryption
+
+    Passing "-encrypt" to put/get/check seals each blob with NaCl
+    secretbox before it reaches the remote blobstore, and opens it
+    again on the way back, using a workspace key (the DATA_BLOB_KEY
+    environment variable, or ~/.data/keyring). Blobs are stored under
+    a key derived from the plaintext hash and the workspace key, so a
+    remote observer with access to the bucket sees neither contents
+    nor which blobs are identical across workspaces. This lets private
+    datasets share the same remote blobstore as public ones.
+
+    Concurrency
+
+    put/get/check transfer blobs concurrently (default: GOMAXPROCS,
+    override with "-j N"), skipping any blob already present on the
+    target side. Downloads are written to "<path>.partial" and renamed
+    into place only once complete, so an interrupted "get -all" can be
+    re-run to pick up where it left off. A progress line is printed as
+    blobs complete; Ctrl-C stops queuing new blobs and waits for the
+    ones in flight to finish, leaving the local blobstore consistent
+    (the local cache index, if one is in use, is written atomically
+    too, so a Ctrl-C mid-touch can't corrupt it).
 
     (data-blob is part of the plumbing, lower level tools.
     Use it directly if you know what you're doing.)
@@ -64,6 +133,7 @@ var cmd_data_blob = &commander.Command{
 	Subcommands: []*commander.Command{
 		cmd_data_blob_put,
 		cmd_data_blob_get,
+		cmd_data_blob_check,
 	},
 }
 
@@ -84,7 +154,8 @@ Arguments:
     <hash>   name (cryptographic hash, checksum) of the blob.
 
   `,
-	Run: blobPutCmd,
+	Run:  blobPutCmd,
+	Flag: *flag.NewFlagSet("data-blob-put", flag.ExitOnError),
 }
 
 var cmd_data_blob_get = &commander.Command{
@@ -108,62 +179,187 @@ Arguments:
 	Flag: *flag.NewFlagSet("data-blob-get", flag.ExitOnError),
 }
 
+var cmd_data_blob_check = &commander.Command{
+	UsageLine: "check <hash>",
+	Short:     "Verify blob contents named by <hash> match <hash>.",
+	Long: `data blob check - Verify blob contents named by <hash> match <hash>.
+
+    Fetches the chunk-list manifest stored under <hash> and recomputes
+    the hash of every chunk it references, failing if any chunk is
+    missing or corrupt.
+
+    See data blob.
+
+Arguments:
+
+    <hash>   name (cryptographic hash, checksum) of the blob.
+
+  `,
+	Run:  blobCheckCmd,
+	Flag: *flag.NewFlagSet("data-blob-check", flag.ExitOnError),
+}
+
 func init() {
 	cmd_data_blob.Flag.Bool("all", false, "all available blobs")
 	cmd_data_blob_get.Flag.Bool("all", false, "get all available blobs")
 	cmd_data_blob_put.Flag.Bool("all", false, "put all available blobs")
+	cmd_data_blob_check.Flag.Bool("all", false, "check all available blobs")
+
+	cmd_data_blob_get.Flag.String("s", "", "blobstore url to use instead of the default (e.g. s3://bucket, file:///path)")
+	cmd_data_blob_put.Flag.String("s", "", "blobstore url to use instead of the default (e.g. s3://bucket, file:///path)")
+	cmd_data_blob_check.Flag.String("s", "", "blobstore url to use instead of the default (e.g. s3://bucket, file:///path)")
+
+	cmd_data_blob_get.Flag.Bool("encrypt", false, "encrypt/decrypt blobs with the workspace key (DATA_BLOB_KEY or ~/.data/keyring)")
+	cmd_data_blob_put.Flag.Bool("encrypt", false, "encrypt/decrypt blobs with the workspace key (DATA_BLOB_KEY or ~/.data/keyring)")
+	cmd_data_blob_check.Flag.Bool("encrypt", false, "encrypt/decrypt blobs with the workspace key (DATA_BLOB_KEY or ~/.data/keyring)")
+
+	cmd_data_blob_get.Flag.Int("j", 0, "number of concurrent blob transfers (default: GOMAXPROCS)")
+	cmd_data_blob_put.Flag.Int("j", 0, "number of concurrent blob transfers (default: GOMAXPROCS)")
+	cmd_data_blob_check.Flag.Int("j", 0, "number of concurrent blob transfers (default: GOMAXPROCS)")
 }
 
 type blobStore interface {
 	Put(key string, value io.Reader) error
 	Get(key string) (io.ReadCloser, error)
+	Stat(key string) (bool, error)
 }
 
 func blobPutCmd(c *commander.Command, args []string) error {
 
-	f := func(d *DataIndex, hash string, paths []string) error {
-		pOut("put blob %.7s %s\n", hash, paths[0])
+	// skip blobs the target already has in full, rather than
+	// re-chunking and re-reading the source file for nothing.
+	skip := func(d *DataIndex, hash string, paths []string) (bool, error) {
+		return d.BlobStore.Stat(manifestKey(hash))
+	}
+
+	f := func(d *DataIndex, hash string, paths []string) (int64, error) {
+		pOut("put blob %s %s\n", shortHash(hash), paths[0])
 		return d.putBlob(hash, paths[0])
 	}
 
 	hashes := blobCmdHashes(c, args)
-	return blobCmdRunFunc(hashes, f)
+	// put never reads the local cache, so it skips -cache-size entirely
+	// rather than pay for opening/creating a cache dir it won't use.
+	return blobCmdRunFunc(hashes, blobCmdStoreURL(c), blobCmdEncrypt(c), 0, blobCmdJobs(c), skip, f)
 }
 
 func blobGetCmd(c *commander.Command, args []string) error {
 
-	f := func(d *DataIndex, hash string, paths []string) error {
-		pOut("get blob %.7s %s\n", hash, paths[0])
+	// skip only once every destination path already exists; a hash
+	// that maps to several paths (duplicate files, same content)
+	// still needs f() to run if any one of them is missing.
+	skip := func(d *DataIndex, hash string, paths []string) (bool, error) {
+		for _, path := range paths {
+			_, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	f := func(d *DataIndex, hash string, paths []string) (int64, error) {
+		pOut("get blob %s %s\n", shortHash(hash), paths[0])
 
-		// download one blob
-		err := d.getBlob(hash, paths[0])
+		// download to a .partial path first, so a transfer interrupted
+		// partway through never leaves paths[0] holding a half-written
+		// blob; -all can just be re-run to pick up where it left off.
+		partial := paths[0] + ".partial"
+		xferred, err := d.getBlob(hash, partial)
 		if err != nil {
-			return err
+			os.Remove(partial)
+			return xferred, err
+		}
+		if err := os.Rename(partial, paths[0]); err != nil {
+			return xferred, err
 		}
 
 		// copy what we got to others
 		for _, path := range paths[1:] {
-			pOut("get blob %.7s %s\n", hash, path)
+			pOut("get blob %s %s\n", shortHash(hash), path)
 			err := copyFile(paths[0], path)
 			if err != nil {
-				return err
+				return xferred, err
 			}
 		}
 
-		return nil
+		return xferred, nil
 	}
 
 	hashes := blobCmdHashes(c, args)
-	return blobCmdRunFunc(hashes, f)
+	cacheSize, err := blobCmdCacheSize(c)
+	if err != nil {
+		return err
+	}
+	return blobCmdRunFunc(hashes, blobCmdStoreURL(c), blobCmdEncrypt(c), cacheSize, blobCmdJobs(c), skip, f)
+}
+
+func blobCheckCmd(c *commander.Command, args []string) error {
+
+	f := func(d *DataIndex, hash string, paths []string) (int64, error) {
+		pOut("check blob %s\n", shortHash(hash))
+		return d.checkBlob(hash)
+	}
+
+	hashes := blobCmdHashes(c, args)
+	cacheSize, err := blobCmdCacheSize(c)
+	if err != nil {
+		return err
+	}
+	return blobCmdRunFunc(hashes, blobCmdStoreURL(c), blobCmdEncrypt(c), cacheSize, blobCmdJobs(c), nil, f)
+}
+
+// blobCmdStoreURL returns the "-s <url>" flag value, or "" if the
+// command has no such flag or it wasn't passed.
+func blobCmdStoreURL(c *commander.Command) string {
+	sFlag := c.Flag.Lookup("s")
+	if sFlag == nil {
+		return ""
+	}
+	return sFlag.Value.Get().(string)
+}
+
+// blobCmdEncrypt returns the "-encrypt" flag value, or false if the
+// command has no such flag.
+func blobCmdEncrypt(c *commander.Command) bool {
+	eFlag := c.Flag.Lookup("encrypt")
+	if eFlag == nil {
+		return false
+	}
+	return eFlag.Value.Get().(bool)
+}
+
+// blobCmdJobs returns the "-j <n>" flag value, or runtime.GOMAXPROCS(0)
+// if the command has no such flag or it wasn't set (or set to <= 0).
+func blobCmdJobs(c *commander.Command) int {
+	jFlag := c.Flag.Lookup("j")
+	if jFlag == nil {
+		return runtime.GOMAXPROCS(0)
+	}
+	if n := jFlag.Value.Get().(int); n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
 }
 
 // Run a blob get/put function on all hashes provided.
 // Do error checking along the way. This function is here to
 // ensure the logic remains the same across functions (duplicated
 // code can diverge).
-type blobCmdFunc func(*DataIndex, string, []string) error
+// blobCmdFunc performs a blob command against one hash, returning the
+// number of bytes actually transferred (chunks read or written, not
+// skipped via dedup) so progress reporting reflects real traffic.
+type blobCmdFunc func(*DataIndex, string, []string) (int64, error)
+
+// blobCmdSkipFunc reports whether a hash's transfer can be skipped
+// because the target side already has it (remote for put, local disk
+// for get). A nil blobCmdSkipFunc never skips.
+type blobCmdSkipFunc func(*DataIndex, string, []string) (bool, error)
 
-func blobCmdRunFunc(hashes []string, f blobCmdFunc) error {
+func blobCmdRunFunc(hashes []string, storeURL string, encrypt bool, cacheSize int64, jobs int, skip blobCmdSkipFunc, f blobCmdFunc) error {
 
 	if len(hashes) < 1 {
 		return fmt.Errorf("at least one <hash> argument required.")
@@ -174,29 +370,167 @@ func blobCmdRunFunc(hashes []string, f blobCmdFunc) error {
 		return err
 	}
 
-	done := map[string]bool{}
+	if storeURL != "" {
+		store, err := newBackendBlobStore(storeURL)
+		if err != nil {
+			return err
+		}
+		dataIndex.BlobStore = store
+	} else if urls, err := loadBlobStoreChain(); err != nil {
+		return err
+	} else if len(urls) > 0 {
+		store, err := newChainBlobStore(urls)
+		if err != nil {
+			return err
+		}
+		dataIndex.BlobStore = store
+	}
 
-	for _, hash := range hashes {
+	if encrypt {
+		key, err := loadBlobKey()
+		if err != nil {
+			return err
+		}
+		dataIndex.BlobStore = NewEncryptingBlobStore(dataIndex.BlobStore, key)
+	}
 
-		if _, found := done[hash]; found {
-			continue
+	if cacheSize > 0 {
+		cacheDir, err := defaultCacheDir()
+		if err != nil {
+			return err
 		}
 
+		cached, err := NewCachingBlobStore(dataIndex.BlobStore, cacheDir, cacheSize)
+		if err != nil {
+			return err
+		}
+		dataIndex.BlobStore = cached
+	}
+
+	hashes = set(hashes)
+	paths := map[string][]string{}
+
+	for _, hash := range hashes {
 		if !isHash(hash) {
 			return fmt.Errorf("invalid <hash>: %v", hash)
 		}
 
-		paths, err := blobPaths(hash)
+		p, err := blobPaths(hash)
 		if err != nil {
 			return err
 		}
+		paths[hash] = p
+	}
 
-		err = f(dataIndex, hash, paths)
-		if err != nil {
-			return err
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	var interrupted int32
+	go func() {
+		select {
+		case <-sigCh:
+			pErr("\ninterrupted, waiting for transfers in flight to finish...\n")
+			atomic.StoreInt32(&interrupted, 1)
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
 
-		done[hash] = true
+	total := len(hashes)
+	tasks := make(chan string, total)
+	for _, hash := range hashes {
+		tasks <- hash
+	}
+	close(tasks)
+
+	var (
+		wg                   sync.WaitGroup
+		mu                   sync.Mutex
+		firstErr             error
+		completed, xferBytes int64
+	)
+	start := time.Now()
+
+	progress := func() {
+		elapsed := time.Since(start).Seconds()
+		rate := "-"
+		if elapsed > 0 {
+			rate = formatSize(int64(float64(xferBytes)/elapsed)) + "/s"
+		}
+		pErr("\r%d/%d blobs, %s transferred, %s", atomic.LoadInt64(&completed), total, formatSize(atomic.LoadInt64(&xferBytes)), rate)
+	}
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for hash := range tasks {
+				if ctx.Err() != nil {
+					return
+				}
+
+				hashPaths := paths[hash]
+				done := false
+				if skip != nil {
+					var err error
+					done, err = skip(dataIndex, hash, hashPaths)
+					if err != nil {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+						cancel()
+						return
+					}
+				}
+
+				if !done {
+					xferred, err := f(dataIndex, hash, hashPaths)
+					if err != nil {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+						cancel()
+						return
+					}
+
+					// f reports bytes actually moved over the wire,
+					// chunk by chunk -- not the whole file's size, so
+					// a mostly-deduplicated transfer doesn't get
+					// credited for chunks it skipped.
+					atomic.AddInt64(&xferBytes, xferred)
+				}
+				atomic.AddInt64(&completed, 1)
+
+				mu.Lock()
+				progress()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	if total > 0 {
+		pErr("\n")
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if atomic.LoadInt32(&interrupted) == 1 {
+		return fmt.Errorf("interrupted: %d/%d blobs transferred", atomic.LoadInt64(&completed), total)
 	}
 
 	return nil
@@ -213,58 +547,169 @@ func blobCmdHashes(c *commander.Command, args []string) []string {
 }
 
 // DataIndex extension to handle putting blob
-func (i *DataIndex) putBlob(hash string, path string) error {
+//
+// The file is split into content-defined chunks (see splitChunks).
+// Each chunk is uploaded as its own blob, skipping any the store
+// already has (Stat check first), and finally a chunk-list manifest
+// recording the chunks, in order, is uploaded under hash.
+func (i *DataIndex) putBlob(hash string, path string) (int64, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer f.Close()
 
-	bf := bufio.NewReader(f)
-	err = i.BlobStore.Put(blobKey(hash), bf)
+	var xferred int64
+	onChunk := func(chash string, data []byte) error {
+		exists, err := i.BlobStore.Stat(blobKey(chash))
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+
+		if err := i.BlobStore.Put(blobKey(chash), bytes.NewReader(data)); err != nil {
+			return err
+		}
+		xferred += int64(len(data))
+		return nil
+	}
+
+	chunks, err := splitChunks(bufio.NewReader(f), hashAlgoOf(hash), onChunk)
 	if err != nil {
-		return err
+		return xferred, err
 	}
 
-	err = f.Close()
+	manifest, err := json.Marshal(chunkList{Chunks: chunks})
 	if err != nil {
-		return err
+		return xferred, err
 	}
 
-	return nil
+	if err := i.BlobStore.Put(manifestKey(hash), bytes.NewReader(manifest)); err != nil {
+		return xferred, err
+	}
+	return xferred + int64(len(manifest)), nil
 }
 
 // DataIndex extension to handle getting blob
-func (i *DataIndex) getBlob(hash string, path string) error {
-	r, err := i.BlobStore.Get(blobKey(hash))
+//
+// Fetches the chunk-list manifest stored under hash, then fetches and
+// concatenates each chunk it references, in order, to reconstruct the
+// original file at path.
+func (i *DataIndex) getBlob(hash string, path string) (int64, error) {
+	cl, err := i.blobChunkList(hash)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer r.Close()
 
-	br := bufio.NewReader(r)
 	w, err := os.Create(path)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer w.Close()
 
-	_, err = io.Copy(w, br)
+	var xferred int64
+	for _, chunk := range cl.Chunks {
+		cr, err := i.BlobStore.Get(blobKey(chunk.Hash))
+		if err != nil {
+			return xferred, err
+		}
+
+		n, err := io.Copy(w, cr)
+		cr.Close()
+		xferred += n
+		if err != nil {
+			return xferred, err
+		}
+	}
+
+	return xferred, w.Close()
+}
+
+// DataIndex extension to verify a chunked blob's integrity: fetch
+// every chunk the manifest under hash references, and confirm its
+// contents still hash to the name it is stored under.
+func (i *DataIndex) checkBlob(hash string) (int64, error) {
+	cl, err := i.blobChunkList(hash)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	err = w.Close()
+	var xferred int64
+	for _, chunk := range cl.Chunks {
+		algo, _, ok := parseHash(chunk.Hash)
+		if !ok {
+			return xferred, fmt.Errorf("chunk-list for %s: unrecognized chunk hash %q", shortHash(hash), chunk.Hash)
+		}
+
+		cr, err := i.BlobStore.Get(blobKey(chunk.Hash))
+		if err != nil {
+			return xferred, err
+		}
+
+		countingCr := &countingReader{r: cr}
+		sum, err := readerHash(countingCr, algo)
+		cr.Close()
+		xferred += countingCr.n
+		if err != nil {
+			return xferred, err
+		}
+
+		if sum != chunk.Hash {
+			return xferred, fmt.Errorf("corrupt chunk: expected %s, got %s", shortHash(chunk.Hash), shortHash(sum))
+		}
+	}
+
+	return xferred, nil
+}
+
+// countingReader wraps an io.Reader, tallying the bytes read through
+// it so callers that hand the reader to something else (e.g.
+// readerHash) can still learn how much actually came back.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// blobChunkList fetches and decodes the chunk-list manifest stored
+// under hash. Blobs published before chunk-list manifests existed
+// have no manifest, only the raw blob contents at blobKey(hash); for
+// those, blobChunkList synthesizes a single-chunk list pointing at
+// the legacy key so get/check keep working unchanged.
+func (i *DataIndex) blobChunkList(hash string) (chunkList, error) {
+	hasManifest, err := i.BlobStore.Stat(manifestKey(hash))
 	if err != nil {
-		return err
+		return chunkList{}, err
+	}
+	if !hasManifest {
+		return chunkList{Chunks: []Chunk{{Hash: hash}}}, nil
 	}
 
-	err = r.Close()
+	r, err := i.BlobStore.Get(manifestKey(hash))
 	if err != nil {
-		return err
+		return chunkList{}, err
+	}
+	defer r.Close()
+
+	var cl chunkList
+	if err := json.NewDecoder(r).Decode(&cl); err != nil {
+		return chunkList{}, err
 	}
 
-	return nil
+	for _, chunk := range cl.Chunks {
+		if _, _, ok := parseHash(chunk.Hash); !ok {
+			return chunkList{}, fmt.Errorf("chunk-list for %s: unrecognized chunk hash %q", shortHash(hash), chunk.Hash)
+		}
+	}
+
+	return cl, nil
 }
 
 func blobPaths(hash string) ([]string, error) {
@@ -274,4 +719,12 @@ func blobPaths(hash string) ([]string, error) {
 
 func blobKey(hash string) string {
 	return fmt.Sprintf("/blob/%s", hash)
-}
\ No newline at end of file
+}
+
+// manifestKey is the key a chunk-list manifest is stored under. It is
+// deliberately distinct from blobKey: a file small enough to fit in a
+// single chunk hashes identically to that chunk, so a manifest sharing
+// the chunk's key would silently overwrite it.
+func manifestKey(hash string) string {
+	return fmt.Sprintf("/blob/manifest/%s", hash)
+}
@@ -0,0 +1,432 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gonuts/flag"
+	"github.com/jbenet/commander"
+	"github.com/jbenet/data/blobstore"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+  Local read-through blob cache
+
+  CachingBlobStore composes a fast local blobstore with a slow remote
+  one: Get checks the local cache first, falling back to the remote
+  and populating the cache on the way through. Because blob keys are
+  content-addressed, a cached entry is never stale -- it only ever
+  needs to be evicted, which happens least-recently-accessed first
+  once the cache's total size exceeds its configured cap.
+
+  The cache lives at ~/.data/cache by default. A small JSON sidecar
+  index (cacheIndexFile) tracks each entry's size and last access time
+  so eviction survives process restarts.
+*/
+
+const (
+	cacheIndexFile   = "index.json"
+	defaultCacheSize = 10 << 30 // 10 GiB
+)
+
+func defaultCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".data", "cache"), nil
+}
+
+// cacheEntry records one cached blob's size and last access time, so
+// evict() can find the least-recently-accessed entry.
+type cacheEntry struct {
+	Size       int64     `json:"size"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// cacheIndex is the JSON sidecar tracking what's in a local cache
+// directory. It is saved after every mutation, so it stays consistent
+// with the blobs actually on disk even if the process is interrupted.
+type cacheIndex struct {
+	path    string
+	mu      sync.Mutex
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+func loadCacheIndex(path string) (*cacheIndex, error) {
+	idx := &cacheIndex{path: path, Entries: map[string]cacheEntry{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(idx); err != nil {
+		// A truncated or corrupt index (e.g. from a crash mid-save)
+		// is not fatal: entries are content-addressed, so rebuilding
+		// from empty just means everything gets re-stat'ed into the
+		// index as it's touched again, at the cost of eviction history.
+		return &cacheIndex{path: path, Entries: map[string]cacheEntry{}}, nil
+	}
+	return idx, nil
+}
+
+func (idx *cacheIndex) save() error {
+	dir := filepath.Dir(idx.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, cacheIndexFile+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, idx.path)
+}
+
+func (idx *cacheIndex) touch(key string, size int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.Entries[key] = cacheEntry{Size: size, AccessedAt: time.Now()}
+	if err := idx.save(); err != nil {
+		dErr("cache index: %v\n", err)
+	}
+}
+
+func (idx *cacheIndex) remove(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.Entries, key)
+	if err := idx.save(); err != nil {
+		dErr("cache index: %v\n", err)
+	}
+}
+
+func (idx *cacheIndex) totalBytes() int64 {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var total int64
+	for _, e := range idx.Entries {
+		total += e.Size
+	}
+	return total
+}
+
+// oldest returns the key of the least-recently-accessed entry, or
+// false if the index is empty.
+func (idx *cacheIndex) oldest() (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var key string
+	var found bool
+	var oldest time.Time
+	for k, e := range idx.Entries {
+		if !found || e.AccessedAt.Before(oldest) {
+			key, oldest, found = k, e.AccessedAt, true
+		}
+	}
+	return key, found
+}
+
+// CachingBlobStore is a read-through cache: Get checks local first,
+// falls back to remote on a miss, and populates local on the way
+// through. Put and Stat pass straight to remote, since the cache only
+// exists to speed up repeated reads.
+type CachingBlobStore struct {
+	local    blobstore.Backend
+	remote   blobStore
+	index    *cacheIndex
+	maxBytes int64
+	evictMu  sync.Mutex
+}
+
+// NewCachingBlobStore wraps remote with a local read-through cache
+// stored at dir, evicting least-recently-accessed blobs once the
+// cache exceeds maxBytes.
+func NewCachingBlobStore(remote blobStore, dir string, maxBytes int64) (*CachingBlobStore, error) {
+	local, err := blobstore.Open("file://" + dir)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := loadCacheIndex(filepath.Join(dir, cacheIndexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CachingBlobStore{local: local, remote: remote, index: index, maxBytes: maxBytes}, nil
+}
+
+func (c *CachingBlobStore) Put(key string, value io.Reader) error {
+	return c.remote.Put(key, value)
+}
+
+func (c *CachingBlobStore) Stat(key string) (bool, error) {
+	return c.remote.Stat(key)
+}
+
+func (c *CachingBlobStore) Get(key string) (io.ReadCloser, error) {
+	if size, exists, err := c.local.Stat(key); err == nil && exists {
+		c.index.touch(key, size)
+		return c.local.Get(key)
+	}
+
+	r, err := c.remote.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.local.Put(key, bytes.NewReader(data), int64(len(data))); err == nil {
+		c.index.touch(key, int64(len(data)))
+		c.evict()
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// evict removes least-recently-accessed blobs until the cache is back
+// under its size cap. It is serialized across concurrent callers (-j
+// workers each call Get, and Get evicts on a miss) so two goroutines
+// never race to delete the same oldest entry.
+func (c *CachingBlobStore) evict() {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+
+	for c.index.totalBytes() > c.maxBytes {
+		key, ok := c.index.oldest()
+		if !ok {
+			return
+		}
+
+		if err := c.local.Delete(key); err != nil && !os.IsNotExist(err) {
+			dErr("cache evict %s: %v\n", key, err)
+			return
+		}
+		c.index.remove(key)
+	}
+}
+
+// parseSize parses a human size like "10GiB", "512MiB", or a bare
+// byte count, into bytes.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"TiB", 1 << 40},
+		{"GiB", 1 << 30},
+		{"MiB", 1 << 20},
+		{"KiB", 1 << 10},
+		{"B", 1},
+	}
+
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid size %q: %v", s, err)
+			}
+			return int64(n * float64(u.mult)), nil
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", s, err)
+	}
+	return n, nil
+}
+
+// formatSize renders a byte count the way --cache-size expects it
+// back (e.g. 10.0GiB).
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<40:
+		return fmt.Sprintf("%.1fTiB", float64(n)/(1<<40))
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
+
+// blobCmdCacheSize returns the "-cache-size" flag value in bytes, or
+// defaultCacheSize if the command has no such flag or it wasn't set.
+func blobCmdCacheSize(c *commander.Command) (int64, error) {
+	sizeFlag := c.Flag.Lookup("cache-size")
+	if sizeFlag == nil {
+		return defaultCacheSize, nil
+	}
+	return parseSize(sizeFlag.Value.Get().(string))
+}
+
+var cmd_data_blob_cache = &commander.Command{
+	UsageLine: "cache <command>",
+	Short:     "Manage the local read-through blob cache.",
+	Long: `data blob cache - Manage the local read-through blob cache.
+
+    data blob get/check keep a local cache of blobs fetched from
+    the remote blobstore (~/.data/cache by default), so repeated reads
+    of the same blob don't go back over a slow link. Since blobs are
+    content-addressed, cached entries never go stale; they are only
+    evicted, least-recently-accessed first, once the cache grows past
+    its size cap ("-cache-size", default 10GiB).
+
+      status  Show cache location, size, and blob count.
+      clear   Remove every cached blob.
+      gc      Evict least-recently-accessed blobs down to the cap.
+
+  `,
+	Subcommands: []*commander.Command{
+		cmd_data_blob_cache_status,
+		cmd_data_blob_cache_clear,
+		cmd_data_blob_cache_gc,
+	},
+}
+
+var cmd_data_blob_cache_status = &commander.Command{
+	UsageLine: "status",
+	Short:     "Show cache location, size, and blob count.",
+	Run:       blobCacheStatusCmd,
+	Flag:      *flag.NewFlagSet("data-blob-cache-status", flag.ExitOnError),
+}
+
+var cmd_data_blob_cache_clear = &commander.Command{
+	UsageLine: "clear",
+	Short:     "Remove every cached blob.",
+	Run:       blobCacheClearCmd,
+}
+
+var cmd_data_blob_cache_gc = &commander.Command{
+	UsageLine: "gc",
+	Short:     "Evict least-recently-accessed blobs down to the cap.",
+	Run:       blobCacheGCCmd,
+	Flag:      *flag.NewFlagSet("data-blob-cache-gc", flag.ExitOnError),
+}
+
+func init() {
+	cmd_data_blob.Subcommands = append(cmd_data_blob.Subcommands, cmd_data_blob_cache)
+
+	cmd_data_blob_get.Flag.String("cache-size", "10GiB", "local read-through cache size cap (e.g. 10GiB, 512MiB)")
+	cmd_data_blob_check.Flag.String("cache-size", "10GiB", "local read-through cache size cap (e.g. 10GiB, 512MiB)")
+
+	cmd_data_blob_cache_status.Flag.String("cache-size", "10GiB", "cache size cap to report against")
+	cmd_data_blob_cache_gc.Flag.String("cache-size", "10GiB", "cache size cap to evict down to")
+}
+
+func blobCacheStatusCmd(c *commander.Command, args []string) error {
+	dir, err := defaultCacheDir()
+	if err != nil {
+		return err
+	}
+
+	idx, err := loadCacheIndex(filepath.Join(dir, cacheIndexFile))
+	if err != nil {
+		return err
+	}
+
+	maxBytes, err := blobCmdCacheSize(c)
+	if err != nil {
+		return err
+	}
+
+	pOut("cache dir:  %s\n", dir)
+	pOut("cache size: %s / %s (%d blobs)\n", formatSize(idx.totalBytes()), formatSize(maxBytes), len(idx.Entries))
+	return nil
+}
+
+func blobCacheClearCmd(c *commander.Command, args []string) error {
+	dir, err := defaultCacheDir()
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	pOut("cleared cache %s\n", dir)
+	return nil
+}
+
+func blobCacheGCCmd(c *commander.Command, args []string) error {
+	dir, err := defaultCacheDir()
+	if err != nil {
+		return err
+	}
+
+	local, err := blobstore.Open("file://" + dir)
+	if err != nil {
+		return err
+	}
+
+	idx, err := loadCacheIndex(filepath.Join(dir, cacheIndexFile))
+	if err != nil {
+		return err
+	}
+
+	maxBytes, err := blobCmdCacheSize(c)
+	if err != nil {
+		return err
+	}
+
+	evicted := 0
+	for idx.totalBytes() > maxBytes {
+		key, ok := idx.oldest()
+		if !ok {
+			break
+		}
+
+		if err := local.Delete(key); err != nil {
+			return err
+		}
+		idx.remove(key)
+		evicted++
+	}
+
+	pOut("evicted %d blobs, cache now %s\n", evicted, formatSize(idx.totalBytes()))
+	return nil
+}
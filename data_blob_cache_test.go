@@ -0,0 +1,66 @@
+package data
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCachingBlobStoreEvictsAcrossCap(t *testing.T) {
+	remote := newMemBlobStore()
+
+	blob1 := bytes.Repeat([]byte("a"), 100)
+	blob2 := bytes.Repeat([]byte("b"), 100)
+	if err := remote.Put("blob1", bytes.NewReader(blob1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Put("blob2", bytes.NewReader(blob2)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	cache, err := NewCachingBlobStore(remote, dir, 150)
+	if err != nil {
+		t.Fatalf("NewCachingBlobStore: %v", err)
+	}
+
+	get := func(key string, want []byte) {
+		t.Helper()
+		r, err := cache.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Get(%s): content mismatch", key)
+		}
+	}
+
+	// Populates the local cache with blob1 (100 bytes, under the cap).
+	get("blob1", blob1)
+	if _, exists, err := cache.local.Stat("blob1"); err != nil || !exists {
+		t.Fatalf("blob1 should be cached locally after Get: exists=%v err=%v", exists, err)
+	}
+
+	// Fetching blob2 pushes the cache to 200 bytes, over the 150 byte
+	// cap, so the least-recently-accessed entry (blob1) is evicted.
+	get("blob2", blob2)
+
+	if _, exists, err := cache.local.Stat("blob1"); err != nil || exists {
+		t.Fatalf("blob1 should have been evicted: exists=%v err=%v", exists, err)
+	}
+	if _, exists, err := cache.local.Stat("blob2"); err != nil || !exists {
+		t.Fatalf("blob2 should still be cached: exists=%v err=%v", exists, err)
+	}
+	if total := cache.index.totalBytes(); total > 150 {
+		t.Fatalf("cache over cap after eviction: %d bytes", total)
+	}
+
+	// blob1 is no longer local, but a re-Get still works by falling
+	// back to remote.
+	get("blob1", blob1)
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang/snappy"
+	"golang.org/x/crypto/nacl/secretbox"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+  Client-side encrypted blobstore
+
+  EncryptingBlobStore wraps a blobStore, transparently encrypting a
+  blob's payload before Put and decrypting it on Get, so private
+  datasets can be pushed to a shared (untrusted) remote blobstore
+  without exposing their contents.
+
+  Each blob is sealed with NaCl secretbox under a random 24-byte nonce,
+  after snappy-compressing the plaintext. The original blob key travels
+  inside the sealed box itself (so Get can verify it decrypted the blob
+  it asked for) rather than in the clear, and the box is prefixed with
+  only a small plaintext header naming the nonce. Blobs are stored
+  under HMAC(key, blob key) rather than the blob key itself, so a
+  remote observer -- who sees neither the plaintext blob key nor the
+  plaintext payload -- can't correlate identical blobs across
+  workspaces that don't share a key.
+*/
+
+const (
+	secretboxMagic     = "#data/secretbox"
+	secretboxNonceSize = 24
+	secretboxKeySize   = 32
+)
+
+// EncryptingBlobStore is a blobStore decorator that encrypts payloads
+// before handing them to inner, and decrypts them on the way back out.
+type EncryptingBlobStore struct {
+	inner blobStore
+	key   [secretboxKeySize]byte
+}
+
+// NewEncryptingBlobStore wraps inner with secretbox encryption under key.
+func NewEncryptingBlobStore(inner blobStore, key [secretboxKeySize]byte) *EncryptingBlobStore {
+	return &EncryptingBlobStore{inner: inner, key: key}
+}
+
+// loadBlobKey reads the workspace's secretbox key: the hex-encoded
+// DATA_BLOB_KEY environment variable if set, otherwise ~/.data/keyring.
+func loadBlobKey() ([secretboxKeySize]byte, error) {
+	if hexKey := os.Getenv("DATA_BLOB_KEY"); hexKey != "" {
+		return decodeBlobKey(hexKey)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return [secretboxKeySize]byte{}, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(home, ".data", "keyring"))
+	if err != nil {
+		return [secretboxKeySize]byte{}, fmt.Errorf("no blob key: %v (set DATA_BLOB_KEY or create ~/.data/keyring)", err)
+	}
+
+	return decodeBlobKey(strings.TrimSpace(string(data)))
+}
+
+func decodeBlobKey(hexKey string) ([secretboxKeySize]byte, error) {
+	var key [secretboxKeySize]byte
+
+	raw, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return key, fmt.Errorf("invalid blob key: %v", err)
+	}
+	if len(raw) != secretboxKeySize {
+		return key, fmt.Errorf("blob key must be %d bytes, got %d", secretboxKeySize, len(raw))
+	}
+
+	copy(key[:], raw)
+	return key, nil
+}
+
+// storageKey derives the key a blob is actually stored under: an HMAC
+// of key under the workspace secret, so the remote blobstore never
+// sees the real blob key (and thus can't correlate identical
+// plaintext across workspaces that use different keys).
+func (e *EncryptingBlobStore) storageKey(key string) string {
+	mac := hmac.New(sha256.New, e.key[:])
+	mac.Write([]byte(key))
+	return blobKey(hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (e *EncryptingBlobStore) Put(key string, value io.Reader) error {
+	plaintext, err := ioutil.ReadAll(value)
+	if err != nil {
+		return err
+	}
+
+	compressed := snappy.Encode(nil, plaintext)
+	sealedPlain := append([]byte(key+"\n"), compressed...)
+
+	var nonce [secretboxNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+
+	box := secretbox.Seal(nil, sealedPlain, &nonce, &e.key)
+
+	header := fmt.Sprintf("%s\n%s\n", secretboxMagic, hex.EncodeToString(nonce[:]))
+	payload := append([]byte(header), box...)
+
+	return e.inner.Put(e.storageKey(key), bytes.NewReader(payload))
+}
+
+func (e *EncryptingBlobStore) Get(key string) (io.ReadCloser, error) {
+	r, err := e.inner.Get(e.storageKey(key))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, box, err := parseSecretboxHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedPlain, ok := secretbox.Open(nil, box, &nonce, &e.key)
+	if !ok {
+		return nil, fmt.Errorf("secretbox: failed to decrypt %s (wrong key or corrupt blob)", shortHash(key))
+	}
+
+	plainKey, compressed, err := splitSealedPlain(sealedPlain)
+	if err != nil {
+		return nil, err
+	}
+	if plainKey != key {
+		return nil, fmt.Errorf("secretbox: key mismatch: expected %s, got %s", shortHash(key), shortHash(plainKey))
+	}
+
+	plaintext, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+func (e *EncryptingBlobStore) Stat(key string) (bool, error) {
+	return e.inner.Stat(e.storageKey(key))
+}
+
+// parseSecretboxHeader splits a stored secretbox payload into the
+// nonce and sealed box it was written with. The blob key is not part
+// of the plaintext header -- it's only recovered once the box is
+// opened, so the remote never sees it.
+func parseSecretboxHeader(data []byte) (nonce [secretboxNonceSize]byte, box []byte, err error) {
+	parts := bytes.SplitN(data, []byte("\n"), 3)
+	if len(parts) != 3 || string(parts[0]) != secretboxMagic {
+		err = fmt.Errorf("secretbox: not a secretbox-encrypted blob")
+		return
+	}
+
+	nonceBytes, decErr := hex.DecodeString(string(parts[1]))
+	if decErr != nil || len(nonceBytes) != secretboxNonceSize {
+		err = fmt.Errorf("secretbox: invalid nonce")
+		return
+	}
+	copy(nonce[:], nonceBytes)
+
+	box = parts[2]
+	return
+}
+
+// splitSealedPlain separates the blob key from the compressed payload
+// inside a decrypted secretbox.
+func splitSealedPlain(sealedPlain []byte) (key string, compressed []byte, err error) {
+	i := bytes.IndexByte(sealedPlain, '\n')
+	if i < 0 {
+		err = fmt.Errorf("secretbox: malformed sealed payload")
+		return
+	}
+	key = string(sealedPlain[:i])
+	compressed = sealedPlain[i+1:]
+	return
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+)
+
+func randomSecretboxKey(t *testing.T) [secretboxKeySize]byte {
+	t.Helper()
+
+	var key [secretboxKeySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptingBlobStoreRoundTrip(t *testing.T) {
+	inner := newMemBlobStore()
+	store := NewEncryptingBlobStore(inner, randomSecretboxKey(t))
+
+	content := []byte("hello, this is a secret blob")
+	if err := store.Put("blob1", bytes.NewReader(content)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r, err := store.Get("blob1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Fatalf("round-tripped content mismatch: got %q, want %q", got, content)
+	}
+
+	// the remote never sees the plaintext
+	for _, data := range inner.data {
+		if bytes.Contains(data, content) {
+			t.Fatalf("plaintext found in inner blobstore: %q", data)
+		}
+	}
+}
+
+func TestEncryptingBlobStoreTamperedRejected(t *testing.T) {
+	inner := newMemBlobStore()
+	store := NewEncryptingBlobStore(inner, randomSecretboxKey(t))
+
+	if err := store.Put("blob1", bytes.NewReader([]byte("some content"))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	storageKey := store.storageKey("blob1")
+	data := inner.data[storageKey]
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 0xff
+	inner.data[storageKey] = tampered
+
+	if _, err := store.Get("blob1"); err == nil {
+		t.Fatal("expected an error reading a tampered blob, got nil")
+	}
+}
+
+func TestEncryptingBlobStoreWrongKeyRejected(t *testing.T) {
+	inner := newMemBlobStore()
+	a := NewEncryptingBlobStore(inner, randomSecretboxKey(t))
+	b := NewEncryptingBlobStore(inner, randomSecretboxKey(t))
+
+	if err := a.Put("blob1", bytes.NewReader([]byte("some content"))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Copy the sealed blob over to the key b would look it up under,
+	// so b attempts to open a box it doesn't hold the key for.
+	inner.data[b.storageKey("blob1")] = inner.data[a.storageKey("blob1")]
+
+	if _, err := b.Get("blob1"); err == nil {
+		t.Fatal("expected an error decrypting with the wrong key, got nil")
+	}
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jbenet/commander"
+	"github.com/jbenet/data/blobstore"
+	"io/ioutil"
+)
+
+var cmd_data_blob_mirror = &commander.Command{
+	UsageLine: "mirror <src-url> <dst-url>",
+	Short:     "Copy blobs missing from dst-url in from src-url.",
+	Long: `data blob mirror - Copy blobs missing from dst-url in from src-url.
+
+    Enumerates every blob in the blobstore at <src-url>, and for each
+    one not already present at <dst-url> (checked with Stat), copies
+    it across. Existing blobs at <dst-url> are left untouched.
+
+    <dst-url> must be a writable backend; today that means file://
+    only (s3://, gs://, http(s)://, ipfs:// are read-only until they
+    grow authenticated/API write support -- see the blobstore package).
+
+    See data blob.
+
+Arguments:
+
+    <src-url>  blobstore url to copy blobs from.
+    <dst-url>  blobstore url to copy blobs to.
+
+  `,
+	Run: blobMirrorCmd,
+}
+
+func init() {
+	cmd_data_blob.Subcommands = append(cmd_data_blob.Subcommands, cmd_data_blob_mirror)
+}
+
+func blobMirrorCmd(c *commander.Command, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("mirror requires exactly <src-url> <dst-url>")
+	}
+
+	src, err := blobstore.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	dst, err := blobstore.Open(args[1])
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan string)
+	enumErr := make(chan error, 1)
+	go func() {
+		enumErr <- src.Enumerate("/blob/", ch)
+	}()
+
+	// Keep ranging over ch even after the first error, so src.Enumerate's
+	// goroutine (blocked mid-send on this unbuffered channel) always gets
+	// to finish instead of leaking.
+	var firstErr error
+	for key := range ch {
+		if firstErr != nil {
+			continue
+		}
+
+		if err := mirrorBlob(src, dst, key); err != nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return <-enumErr
+}
+
+// mirrorBlob copies key from src to dst if dst doesn't already have it.
+func mirrorBlob(src, dst blobstore.Backend, key string) error {
+	_, exists, err := dst.Stat(key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	pOut("mirror %s\n", key)
+
+	size, _, err := src.Stat(key)
+	if err != nil {
+		return err
+	}
+
+	r, err := src.Get(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	return dst.Put(key, bytes.NewReader(data), size)
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/jbenet/data/blobstore"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+  Pluggable blobstores
+
+  blobStore (see data_blob.go) is this package's minimal Put/Get/Stat
+  contract. blobstore.Backend (in the blobstore package) is the richer
+  contract real backends implement, keyed off a URL scheme (s3://,
+  file://, http(s)://, ipfs://, gs://). backendBlobStore adapts one to
+  the other, so "-s <url>" can swap in any registered backend without
+  the rest of the package (or DataIndex.BlobStore's type) changing.
+
+  ~/.data/blobstores (see loadBlobStoreChain) optionally names an
+  ordered chain of backend URLs to fall back across on read: the first
+  store is authoritative for Put, and Get/Stat try each store in turn
+  until one has the blob. This is how a workspace can read from a slow
+  or incomplete mirror first and fall back to the origin, without
+  recompiling or passing "-s" on every command.
+*/
+
+// backendBlobStore adapts a blobstore.Backend to the blobStore
+// interface used throughout this package.
+type backendBlobStore struct {
+	backend blobstore.Backend
+}
+
+func newBackendBlobStore(url string) (blobStore, error) {
+	b, err := blobstore.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	return &backendBlobStore{backend: b}, nil
+}
+
+func (s *backendBlobStore) Put(key string, value io.Reader) error {
+	// blobstore.Backend.Put wants the size up front; buffer it.
+	data, err := ioutil.ReadAll(value)
+	if err != nil {
+		return err
+	}
+	return s.backend.Put(key, bytes.NewReader(data), int64(len(data)))
+}
+
+func (s *backendBlobStore) Get(key string) (io.ReadCloser, error) {
+	return s.backend.Get(key)
+}
+
+func (s *backendBlobStore) Stat(key string) (bool, error) {
+	_, exists, err := s.backend.Stat(key)
+	return exists, err
+}
+
+// chainBlobStore reads across an ordered chain of blobStores, falling
+// back from one to the next until one has the key. Writes always go
+// to the first store -- the rest are only read from, as fallbacks,
+// e.g. the origin behind a local mirror listed first.
+type chainBlobStore struct {
+	stores []blobStore
+}
+
+// newChainBlobStore opens a backendBlobStore for each url, in order,
+// and returns a blobStore that reads across the chain.
+func newChainBlobStore(urls []string) (blobStore, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("blobstore chain: no urls given")
+	}
+
+	stores := make([]blobStore, len(urls))
+	for i, url := range urls {
+		store, err := newBackendBlobStore(url)
+		if err != nil {
+			return nil, fmt.Errorf("blobstore chain: %s: %v", url, err)
+		}
+		stores[i] = store
+	}
+	return &chainBlobStore{stores: stores}, nil
+}
+
+func (c *chainBlobStore) Put(key string, value io.Reader) error {
+	return c.stores[0].Put(key, value)
+}
+
+func (c *chainBlobStore) Get(key string) (io.ReadCloser, error) {
+	var err error
+	for _, store := range c.stores {
+		var r io.ReadCloser
+		if r, err = store.Get(key); err == nil {
+			return r, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *chainBlobStore) Stat(key string) (bool, error) {
+	for _, store := range c.stores {
+		exists, err := store.Stat(key)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// blobStoresConfigPath is where loadBlobStoreChain looks for its
+// chain of blobstore URLs, mirroring the ~/.data/keyring convention used
+// by loadBlobKey.
+func blobStoresConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".data", "blobstores"), nil
+}
+
+// loadBlobStoreChain reads the ordered list of read-fallback backend
+// URLs from ~/.data/blobstores: one URL per line, blank lines and
+// "#"-prefixed comments ignored. A missing file is not an error -- it
+// just means no chain is configured, so callers should keep whatever
+// blobStore they already had.
+func loadBlobStoreChain() ([]string, error) {
+	path, err := blobStoresConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
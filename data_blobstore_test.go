@@ -0,0 +1,93 @@
+package data
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChainBlobStoreFallsBackOnGet(t *testing.T) {
+	primary := newMemBlobStore()
+	fallback := newMemBlobStore()
+
+	if err := fallback.Put("/blob/abc", bytes.NewReader([]byte("from fallback"))); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := &chainBlobStore{stores: []blobStore{primary, fallback}}
+
+	r, err := chain.Get("/blob/abc")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "from fallback" {
+		t.Fatalf("Get = %q, want %q", got, "from fallback")
+	}
+
+	if exists, err := chain.Stat("/blob/abc"); err != nil || !exists {
+		t.Fatalf("Stat = %v, %v, want true, nil", exists, err)
+	}
+}
+
+func TestChainBlobStorePutsOnlyToFirst(t *testing.T) {
+	primary := newMemBlobStore()
+	fallback := newMemBlobStore()
+	chain := &chainBlobStore{stores: []blobStore{primary, fallback}}
+
+	if err := chain.Put("/blob/abc", bytes.NewReader([]byte("hi"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := primary.data["/blob/abc"]; !ok {
+		t.Fatal("Put did not reach the first store")
+	}
+	if _, ok := fallback.data["/blob/abc"]; ok {
+		t.Fatal("Put reached a fallback store")
+	}
+}
+
+func TestLoadBlobStoreChainMissingFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	urls, err := loadBlobStoreChain()
+	if err != nil {
+		t.Fatalf("loadBlobStoreChain: %v", err)
+	}
+	if urls != nil {
+		t.Fatalf("loadBlobStoreChain = %v, want nil for a missing config", urls)
+	}
+}
+
+func TestLoadBlobStoreChainParsesURLsAndComments(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if err := os.MkdirAll(filepath.Join(home, ".data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	contents := "# primary, then two fallbacks\nfile:///primary\n\nfile:///fallback-one\nfile:///fallback-two\n"
+	if err := ioutil.WriteFile(filepath.Join(home, ".data", "blobstores"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	urls, err := loadBlobStoreChain()
+	if err != nil {
+		t.Fatalf("loadBlobStoreChain: %v", err)
+	}
+	want := []string{"file:///primary", "file:///fallback-one", "file:///fallback-two"}
+	if len(urls) != len(want) {
+		t.Fatalf("loadBlobStoreChain = %v, want %v", urls, want)
+	}
+	for i := range want {
+		if urls[i] != want[i] {
+			t.Fatalf("loadBlobStoreChain = %v, want %v", urls, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+/*
+  Content-defined chunking
+
+  Large blobs are split into content-defined chunks so that near-
+  duplicate files share chunks in the blobstore (deduplication) and
+  interrupted transfers can resume at chunk granularity.
+
+  Boundaries are found with a rolling hash over a sliding window of
+  chunkWindow bytes: a boundary is emitted whenever the rolling hash's
+  low bits are all zero (hash & chunkMask == 0). Boundaries are only
+  looked for once a chunk reaches chunkMinSize, and then turn up about
+  once every chunkTargetSize bytes, so chunks average roughly
+  chunkMinSize+chunkTargetSize; chunkMaxSize is a hard cutoff.
+*/
+
+const (
+	chunkWindow     = 64
+	chunkTargetSize = 1 << 20  // ~1 MiB
+	chunkMinSize    = 512 << 10
+	chunkMaxSize    = 8 << 20
+	chunkMask       = chunkTargetSize - 1
+)
+
+// Chunk is one content-addressed piece of a chunked blob.
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// chunkList is the manifest stored under a blob's hash: the ordered
+// list of chunks that, concatenated, reconstruct the blob.
+type chunkList struct {
+	Chunks []Chunk `json:"chunks"`
+}
+
+// rollingHash is a small buzhash-style rolling checksum over a fixed
+// window, used only to locate chunk boundaries (it is not used for
+// addressing, so it need not be cryptographically strong).
+type rollingHash struct {
+	window [chunkWindow]byte
+	pos    int
+	h      uint32
+}
+
+var buzTable [256]uint32
+
+func init() {
+	// Fixed pseudo-random table; no need for it to be secret.
+	seed := uint32(2166136261)
+	for i := range buzTable {
+		seed ^= seed << 13
+		seed ^= seed >> 17
+		seed ^= seed << 5
+		buzTable[i] = seed
+	}
+}
+
+func rotl(x uint32, n uint) uint32 {
+	return (x << n) | (x >> (32 - n))
+}
+
+func (r *rollingHash) roll(b byte) uint32 {
+	out := r.window[r.pos]
+	r.window[r.pos] = b
+	r.pos = (r.pos + 1) % chunkWindow
+	r.h = rotl(r.h, 1) ^ rotl(buzTable[out], chunkWindow%32) ^ buzTable[b]
+	return r.h
+}
+
+// splitChunks reads all of r, calling onChunk with each chunk's hash
+// (under algo) and contents as it is found, and returns the ordered
+// list of chunks (hash + size) that make up r.
+func splitChunks(r io.Reader, algo string, onChunk func(hash string, data []byte) error) ([]Chunk, error) {
+	br := bufio.NewReaderSize(r, chunkMaxSize)
+
+	var chunks []Chunk
+	var buf []byte
+	var rh rollingHash
+
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+
+		hash, err := readerHash(bytes.NewReader(buf), algo)
+		if err != nil {
+			return err
+		}
+
+		if err := onChunk(hash, buf); err != nil {
+			return err
+		}
+
+		chunks = append(chunks, Chunk{Hash: hash, Size: int64(len(buf))})
+		buf = nil
+		rh = rollingHash{}
+		return nil
+	}
+
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, b)
+		sum := rh.roll(b)
+
+		boundary := len(buf) >= chunkMinSize && sum&chunkMask == 0
+		if boundary || len(buf) >= chunkMaxSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"hash"
+	"io"
+	"strings"
+	"unicode"
+)
+
+/*
+  Pluggable hash algorithms
+
+  Blob hashes are multihash-style strings: "<algo>-<hex>" (e.g.
+  "sha256-abcd..."), with one exception kept for backwards compatibility
+  -- a bare 40-hex-character string is read as a legacy sha1 hash, with
+  no prefix. Any hash can name "sha256" or "blake2b" by prefix; sha1
+  remains the default (DefaultHashAlgo) for anything that doesn't.
+
+  A Datafile can declare "hash: sha256" (or blake2b) to request a
+  stronger, collision-resistant algorithm for its dataset; see
+  Datafile.HashAlgo. Nothing in this package calls it yet -- computing
+  a new file's hash when it's added to a dataset happens outside this
+  package (Manifest), so wiring HashAlgo through to that is left to
+  whatever adds that codepath.
+*/
+
+// DefaultHashAlgo is used when nothing declares a hash algorithm, and
+// is the one algorithm whose hashes are written without a prefix.
+const DefaultHashAlgo = "sha1"
+
+var hashAlgos = map[string]struct {
+	new     func() hash.Hash
+	hexSize int
+}{
+	"sha1":    {sha1.New, 40},
+	"sha256":  {sha256.New, 64},
+	"blake2b": {newBlake2b256, 64},
+}
+
+func newBlake2b256() hash.Hash {
+	h, _ := blake2b.New256(nil)
+	return h
+}
+
+func newHasher(algo string) (hash.Hash, error) {
+	a, found := hashAlgos[algo]
+	if !found {
+		return nil, fmt.Errorf("unknown hash algorithm: %q", algo)
+	}
+	return a.new(), nil
+}
+
+// formatHash joins an algorithm and a hex digest into a blob hash.
+func formatHash(algo string, hex string) string {
+	if algo == DefaultHashAlgo {
+		return hex
+	}
+	return algo + "-" + hex
+}
+
+// parseHash splits a blob hash into its algorithm and hex digest. A
+// bare 40-hex-character string is treated as a legacy sha1 hash.
+// ok is false if hash isn't validly formed for a known algorithm.
+func parseHash(hashStr string) (algo string, hex string, ok bool) {
+	if isHexDigits(hashStr) && len(hashStr) == hashAlgos[DefaultHashAlgo].hexSize {
+		return DefaultHashAlgo, hashStr, true
+	}
+
+	i := strings.Index(hashStr, "-")
+	if i < 0 {
+		return "", "", false
+	}
+
+	algo, hex = hashStr[:i], hashStr[i+1:]
+	a, found := hashAlgos[algo]
+	if !found || !isHexDigits(hex) || len(hex) != a.hexSize {
+		return "", "", false
+	}
+
+	return algo, hex, true
+}
+
+// hashAlgoOf returns the algorithm hashStr was produced with, falling
+// back to DefaultHashAlgo if it isn't recognized (callers validate
+// with isHash first).
+func hashAlgoOf(hashStr string) string {
+	algo, _, ok := parseHash(hashStr)
+	if !ok {
+		return DefaultHashAlgo
+	}
+	return algo
+}
+
+func isHexDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.Is(unicode.ASCII_Hex_Digit, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// readerHash reads all of r and returns its hash under algo.
+func readerHash(r io.Reader, algo string) (string, error) {
+	h, err := newHasher(algo)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return formatHash(algo, fmt.Sprintf("%x", h.Sum(nil))), nil
+}
@@ -0,0 +1,60 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHashLegacySHA1(t *testing.T) {
+	sha1Hash := strings.Repeat("a", 40)
+	algo, hex, ok := parseHash(sha1Hash)
+	if !ok || algo != "sha1" || hex != sha1Hash {
+		t.Fatalf("parseHash(%q) = %q, %q, %v", sha1Hash, algo, hex, ok)
+	}
+}
+
+func TestParseHashPrefixedAlgos(t *testing.T) {
+	for algo, info := range hashAlgos {
+		if algo == DefaultHashAlgo {
+			continue
+		}
+
+		hex := strings.Repeat("b", info.hexSize)
+		hashStr := formatHash(algo, hex)
+
+		gotAlgo, gotHex, ok := parseHash(hashStr)
+		if !ok || gotAlgo != algo || gotHex != hex {
+			t.Fatalf("parseHash(%q) = %q, %q, %v; want %q, %q, true", hashStr, gotAlgo, gotHex, ok, algo, hex)
+		}
+	}
+}
+
+func TestParseHashInvalid(t *testing.T) {
+	for _, s := range []string{"", "not-a-hash", "sha256-tooshort", strings.Repeat("z", 40)} {
+		if _, _, ok := parseHash(s); ok {
+			t.Fatalf("parseHash(%q) = ok, want invalid", s)
+		}
+	}
+}
+
+func TestReaderHashRoundTrip(t *testing.T) {
+	content := []byte("hash me please")
+
+	for algo := range hashAlgos {
+		sum, err := readerHash(strings.NewReader(string(content)), algo)
+		if err != nil {
+			t.Fatalf("readerHash(%s): %v", algo, err)
+		}
+
+		gotAlgo, _, ok := parseHash(sum)
+		if !ok {
+			t.Fatalf("readerHash(%s) produced unparsable hash %q", algo, sum)
+		}
+		if gotAlgo != algo {
+			t.Fatalf("readerHash(%s) produced a %s hash", algo, gotAlgo)
+		}
+		if hashAlgoOf(sum) != algo {
+			t.Fatalf("hashAlgoOf(%q) = %q, want %q", sum, hashAlgoOf(sum), algo)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
   (optional functionality:)
   dependencies: [<other dataset handles>]
   formats: {<format> : <format url>}
+  hash: <algorithm>  # sha256, blake2b; defaults to sha1 if unset
 
   (optional information:)
   description: Text describing dataset.
@@ -34,6 +35,7 @@ type datafileContents struct {
 	Mirrors      []string          ",omitempty"
 	Dependencies []string          ",omitempty"
 	Formats      map[string]string ",omitempty"
+	Hash         string            ",omitempty"
 
 	Description  string   ",omitempty"
 	Repository   string   ",omitempty"
@@ -79,3 +81,20 @@ func (d *Datafile) Handle() *Handle {
 func (d *Datafile) Valid() bool {
 	return d.Handle().Valid()
 }
+
+// HashAlgo returns the hash algorithm this Datafile declares via its
+// "hash" key (e.g. "sha256", "blake2b"), or DefaultHashAlgo if it
+// doesn't declare one, or declares an algorithm this version of data
+// doesn't know.
+//
+// Nothing in this package calls HashAlgo yet: computing a new file's
+// hash when it's added to a dataset happens in the (not-yet-present
+// in this tree) Manifest package, so wiring this through putBlob,
+// getBlob, blobCmdRunFunc, and validHashes is left to whatever adds
+// that codepath.
+func (d *Datafile) HashAlgo() string {
+	if _, ok := hashAlgos[d.Hash]; ok {
+		return d.Hash
+	}
+	return DefaultHashAlgo
+}
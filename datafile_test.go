@@ -0,0 +1,19 @@
+package data
+
+import "testing"
+
+func TestDatafileHashAlgoDeclared(t *testing.T) {
+	df := &Datafile{datafileContents: datafileContents{Hash: "sha256"}}
+	if got := df.HashAlgo(); got != "sha256" {
+		t.Fatalf("HashAlgo() = %q, want %q", got, "sha256")
+	}
+}
+
+func TestDatafileHashAlgoDefaultsWhenUnsetOrUnknown(t *testing.T) {
+	for _, hash := range []string{"", "made-up-algo"} {
+		df := &Datafile{datafileContents: datafileContents{Hash: hash}}
+		if got := df.HashAlgo(); got != DefaultHashAlgo {
+			t.Fatalf("HashAlgo() with Hash=%q = %q, want %q", hash, got, DefaultHashAlgo)
+		}
+	}
+}
@@ -1,13 +1,9 @@
 package data
 
 import (
-	"bufio"
-	"crypto/sha1"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
-	"unicode"
 )
 
 var Debug bool
@@ -33,35 +29,31 @@ func dOut(format string, a ...interface{}) {
 	}
 }
 
-// Checks whether string is a hash (sha1)
+// Checks whether string is a hash: either "<algo>-<hex>" for a known
+// algorithm, or a bare 40-hex-character legacy sha1 hash.
 func isHash(hash string) bool {
-	if len(hash) != 40 {
-		return false
-	}
-
-	for _, r := range hash {
-		if !unicode.Is(unicode.ASCII_Hex_Digit, r) {
-			return false
-		}
-	}
-
-	return true
+	_, _, ok := parseHash(hash)
+	return ok
 }
 
+// shortHash renders hash for display: an algorithm prefix (if any)
+// plus a short slice of its hex digest, e.g. "sha256-abc1234" or the
+// bare "abc1234" for legacy sha1 hashes. %.7s truncation doesn't work
+// once hashes can carry an "<algo>-" prefix, since every hash of a
+// given algorithm would then print identically.
 func shortHash(hash string) string {
-	return hash[:7]
-}
-
-func readerHash(r io.Reader) (string, error) {
-	bf := bufio.NewReader(r)
-	h := sha1.New()
-	_, err := bf.WriteTo(h)
-	if err != nil {
-		return "", err
+	algo, hex, ok := parseHash(hash)
+	if !ok {
+		if len(hash) > 7 {
+			return hash[:7]
+		}
+		return hash
 	}
 
-	hex := fmt.Sprintf("%x", h.Sum(nil))
-	return hex, nil
+	if len(hex) > 7 {
+		hex = hex[:7]
+	}
+	return formatHash(algo, hex)
 }
 
 func copyFile(src string, dst string) error {